@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/google/go-github/v89/github"
+)
+
+// caddyfileMu serializes Caddyfile update+reload sequences so
+// concurrent webhooks can't interleave writes or race each other's
+// rollback.
+var caddyfileMu sync.Mutex
+
+// applyPushEvent updates the Caddyfile for event under ruleSet, then
+// validates (if the chosen reload backend supports it) and reloads
+// Caddy. If validation or reload fails, the previous Caddyfile contents
+// are restored and, on a failed reload, a reload is re-issued so Caddy
+// ends up running the last known-good config.
+func applyPushEvent(ctx context.Context, ruleSet *RuleSet, defaultReloader Reloader, event *github.PushEvent) error {
+	caddyfileMu.Lock()
+	defer caddyfileMu.Unlock()
+
+	reloadName, backup, err := updateCaddyfile(ruleSet, event)
+	if err != nil {
+		return err
+	}
+	log.Println("Caddyfile updated successfully.")
+
+	r := defaultReloader
+	if reloadName != "" {
+		override, err := reloaderFor(reloadName)
+		if err != nil {
+			if rbErr := restoreCaddyfile(backup); rbErr != nil {
+				return fmt.Errorf("rule names unknown reload backend %q: %w (rollback also failed: %v)", reloadName, err, rbErr)
+			}
+			return fmt.Errorf("rule names unknown reload backend %q, rolled back: %w", reloadName, err)
+		}
+		r = override
+	}
+
+	if v, ok := r.(Validator); ok {
+		if err := v.Validate(ctx); err != nil {
+			if rbErr := restoreCaddyfile(backup); rbErr != nil {
+				return fmt.Errorf("validate caddyfile: %w (rollback also failed: %v)", err, rbErr)
+			}
+			return fmt.Errorf("validate caddyfile, rolled back: %w", err)
+		}
+	}
+
+	if err := r.Reload(ctx); err != nil {
+		if rbErr := restoreCaddyfile(backup); rbErr != nil {
+			return fmt.Errorf("reload: %w (rollback also failed: %v)", err, rbErr)
+		}
+		if reloadErr := r.Reload(ctx); reloadErr != nil {
+			return fmt.Errorf("reload: %w (rolled back, but re-reload also failed: %v)", err, reloadErr)
+		}
+		return fmt.Errorf("reload, rolled back to previous caddyfile: %w", err)
+	}
+
+	return nil
+}
+
+// restoreCaddyfile writes backup back to caddyFilePath.
+func restoreCaddyfile(backup []byte) error {
+	log.Println("Restoring previous Caddyfile contents.")
+	return atomicWriteFile(caddyFilePath, backup)
+}
+
+// atomicWriteFile writes data to path by writing to a sibling temp file
+// and renaming it over path, so readers (Caddy included) never observe
+// a partially written file. When path already exists, its mode is
+// preserved and its ownership is preserved where this process is
+// allowed to chown (see below).
+func atomicWriteFile(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	uid, gid := -1, -1
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode()
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, mode); err != nil {
+		return fmt.Errorf("write temp file: %w", err)
+	}
+	// os.WriteFile's mode is filtered by the umask (and ignored for an
+	// existing temp file), so set it explicitly.
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("chmod temp file: %w", err)
+	}
+	if uid >= 0 {
+		// Best effort: an unprivileged process can only chown a file to
+		// its own uid, so this fails whenever the Caddyfile is owned by
+		// someone else, which is the common case for the admin API
+		// backend. Log it and continue — the rename still makes the new
+		// content live, just under the temp file's own ownership.
+		if err := os.Chown(tmp, uid, gid); err != nil {
+			log.Println("preserve caddyfile ownership:", err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename temp file: %w", err)
+	}
+	return nil
+}
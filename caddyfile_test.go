@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/google/go-github/v89/github"
+)
+
+// fakeReloader is a Reloader (and optionally Validator) whose behavior is
+// scripted per-call, so applyPushEvent's validate/reload/rollback
+// orchestration can be tested without a real Docker daemon or admin API.
+type fakeReloader struct {
+	validateErr error
+
+	// reloadErrs is consumed one error per Reload call; once exhausted,
+	// Reload succeeds. This lets a test script "fails once, then
+	// succeeds on the reissued reload".
+	reloadErrs []error
+
+	validateCalls int
+	reloadCalls   int
+}
+
+func (f *fakeReloader) Validate(ctx context.Context) error {
+	f.validateCalls++
+	return f.validateErr
+}
+
+func (f *fakeReloader) Reload(ctx context.Context) error {
+	defer func() { f.reloadCalls++ }()
+	if f.reloadCalls < len(f.reloadErrs) {
+		return f.reloadErrs[f.reloadCalls]
+	}
+	return nil
+}
+
+// pushRuleSetAndEvent returns a RuleSet/PushEvent pair that match each
+// other, so updateCaddyfile applies without error, for tests exercising
+// what happens after the Caddyfile write.
+func pushRuleSetAndEvent() (*RuleSet, *github.PushEvent) {
+	ruleSet := &RuleSet{Rules: []Rule{{
+		Repo:   "acme/api",
+		Branch: "main",
+		Event:  "push",
+		Patterns: []Pattern{
+			{ID: "pin", Regex: `PLACEHOLDER`, Replace: "{{.SHA}}"},
+		},
+	}}}
+	event := &github.PushEvent{
+		Ref:   github.String("refs/heads/main"),
+		After: github.String("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"),
+		Repo:  &github.PushEventRepository{FullName: github.String("acme/api")},
+	}
+	return ruleSet, event
+}
+
+// withTempCaddyfile points the package-level caddyFilePath at a temp file
+// seeded with content for the duration of the test.
+func withTempCaddyfile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("seed caddyfile: %v", err)
+	}
+	prev := caddyFilePath
+	caddyFilePath = path
+	t.Cleanup(func() { caddyFilePath = prev })
+	return path
+}
+
+func TestApplyPushEventValidateFailureRollsBack(t *testing.T) {
+	path := withTempCaddyfile(t, "reverse_proxy PLACEHOLDER")
+	ruleSet, event := pushRuleSetAndEvent()
+	reloader := &fakeReloader{validateErr: errors.New("bad config")}
+
+	err := applyPushEvent(context.Background(), ruleSet, reloader, event)
+	if err == nil {
+		t.Fatal("expected an error when validation fails")
+	}
+	if !strings.Contains(err.Error(), "bad config") {
+		t.Errorf("error %q doesn't mention the validate failure", err.Error())
+	}
+	if reloader.reloadCalls != 0 {
+		t.Errorf("Reload called %d times, want 0 (validate should fail first)", reloader.reloadCalls)
+	}
+
+	got, readErr := os.ReadFile(path)
+	if readErr != nil {
+		t.Fatalf("read back: %v", readErr)
+	}
+	if string(got) != "reverse_proxy PLACEHOLDER" {
+		t.Errorf("caddyfile = %q, want the original content restored", got)
+	}
+}
+
+func TestApplyPushEventUnknownReloadBackendRollsBack(t *testing.T) {
+	path := withTempCaddyfile(t, "reverse_proxy PLACEHOLDER")
+	ruleSet, event := pushRuleSetAndEvent()
+	ruleSet.Rules[0].Reload = "bogus"
+	reloader := &fakeReloader{}
+
+	err := applyPushEvent(context.Background(), ruleSet, reloader, event)
+	if err == nil {
+		t.Fatal("expected an error for an unknown reload backend")
+	}
+	if reloader.validateCalls != 0 || reloader.reloadCalls != 0 {
+		t.Errorf("validateCalls=%d reloadCalls=%d, want 0 and 0 (should fail before using the default reloader)", reloader.validateCalls, reloader.reloadCalls)
+	}
+
+	got, readErr := os.ReadFile(path)
+	if readErr != nil {
+		t.Fatalf("read back: %v", readErr)
+	}
+	if string(got) != "reverse_proxy PLACEHOLDER" {
+		t.Errorf("caddyfile = %q, want the original content restored", got)
+	}
+}
+
+func TestApplyPushEventReloadFailureRollsBackAndReissuesReload(t *testing.T) {
+	path := withTempCaddyfile(t, "reverse_proxy PLACEHOLDER")
+	ruleSet, event := pushRuleSetAndEvent()
+	reloader := &fakeReloader{reloadErrs: []error{errors.New("reload failed")}}
+
+	err := applyPushEvent(context.Background(), ruleSet, reloader, event)
+	if err == nil {
+		t.Fatal("expected an error when reload fails")
+	}
+	if !strings.Contains(err.Error(), "reload failed") {
+		t.Errorf("error %q doesn't mention the reload failure", err.Error())
+	}
+	if reloader.reloadCalls != 2 {
+		t.Errorf("Reload called %d times, want 2 (initial + reissue after rollback)", reloader.reloadCalls)
+	}
+
+	got, readErr := os.ReadFile(path)
+	if readErr != nil {
+		t.Fatalf("read back: %v", readErr)
+	}
+	if string(got) != "reverse_proxy PLACEHOLDER" {
+		t.Errorf("caddyfile = %q, want the original content restored", got)
+	}
+}
+
+func TestApplyPushEventReloadAndReissueBothFail(t *testing.T) {
+	withTempCaddyfile(t, "reverse_proxy PLACEHOLDER")
+	ruleSet, event := pushRuleSetAndEvent()
+	reloader := &fakeReloader{reloadErrs: []error{errors.New("reload failed"), errors.New("reissue also failed")}}
+
+	err := applyPushEvent(context.Background(), ruleSet, reloader, event)
+	if err == nil {
+		t.Fatal("expected an error when both the reload and the reissued reload fail")
+	}
+	if !strings.Contains(err.Error(), "reload failed") || !strings.Contains(err.Error(), "reissue also failed") {
+		t.Errorf("error %q doesn't mention both failures", err.Error())
+	}
+}
+
+func TestApplyPushEventSuccess(t *testing.T) {
+	withTempCaddyfile(t, "reverse_proxy PLACEHOLDER")
+	ruleSet, event := pushRuleSetAndEvent()
+	reloader := &fakeReloader{}
+
+	if err := applyPushEvent(context.Background(), ruleSet, reloader, event); err != nil {
+		t.Fatalf("applyPushEvent: %v", err)
+	}
+	if reloader.validateCalls != 1 || reloader.reloadCalls != 1 {
+		t.Errorf("validateCalls=%d reloadCalls=%d, want 1 and 1", reloader.validateCalls, reloader.reloadCalls)
+	}
+}
+
+func TestAtomicWriteFileCreatesNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+
+	if err := atomicWriteFile(path, []byte("hello")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file %s.tmp left behind", path)
+	}
+}
+
+func TestAtomicWriteFilePreservesMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+	if err := os.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	if err := atomicWriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("atomicWriteFile: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if info.Mode() != 0600 {
+		t.Errorf("mode = %v, want %v", info.Mode(), os.FileMode(0600))
+	}
+}
+
+// TestAtomicWriteFileSurvivesChownFailure ensures a chown failure (the
+// norm when the Caddyfile is owned by a different user than this
+// process, e.g. under the admin API reloader) is logged and ignored
+// rather than aborting the write.
+func TestAtomicWriteFileSurvivesChownFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		t.Skip("syscall.Stat_t not available on this platform")
+	}
+	if int(stat.Uid) == os.Getuid() {
+		t.Skip("running as the file owner; can't exercise a chown failure")
+	}
+
+	if err := atomicWriteFile(path, []byte("new")); err != nil {
+		t.Fatalf("atomicWriteFile should tolerate a chown failure, got: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read back: %v", err)
+	}
+	if string(got) != "new" {
+		t.Errorf("content = %q, want %q", got, "new")
+	}
+}
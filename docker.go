@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+// DockerClient is the subset of the Docker Engine API client we depend on.
+// It exists so tests can inject a fake instead of talking to a real daemon.
+type DockerClient interface {
+	ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error)
+	ContainerExecCreate(ctx context.Context, containerID string, config container.ExecOptions) (types.IDResponse, error)
+	ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error)
+}
+
+// newDockerClient builds a Docker client from the standard environment
+// variables (DOCKER_HOST, DOCKER_TLS_VERIFY, DOCKER_CERT_PATH, ...), so
+// the tool talks to whatever daemon is configured for it: a local unix
+// socket, or a remote TCP+TLS daemon. The API version is negotiated
+// against the daemon instead of being pinned.
+func newDockerClient() (DockerClient, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, errdefs.NewInvalidConfig(fmt.Errorf("create docker client: %w", err))
+	}
+	return cli, nil
+}
+
+// resolveContainerID resolves CADDY_CONTAINER to a container ID. The
+// selector may be a container name, an ID (or ID prefix), or a label
+// selector in "key=value" form.
+func resolveContainerID(ctx context.Context, cli DockerClient, selector string) (string, error) {
+	if key, value, ok := strings.Cut(selector, "="); ok {
+		f := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", key, value)))
+		containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: f})
+		if err != nil {
+			return "", wrapDockerErr(fmt.Errorf("list containers by label %q: %w", selector, err))
+		}
+		if len(containers) == 0 {
+			return "", errdefs.NewNotFound(fmt.Errorf("no container matches label selector %q", selector))
+		}
+		return containers[0].ID, nil
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return "", wrapDockerErr(fmt.Errorf("list containers: %w", err))
+	}
+	for _, c := range containers {
+		if strings.HasPrefix(c.ID, selector) {
+			return c.ID, nil
+		}
+		for _, n := range c.Names {
+			if strings.TrimPrefix(n, "/") == selector {
+				return c.ID, nil
+			}
+		}
+	}
+	return "", errdefs.NewNotFound(fmt.Errorf("container %q not found", selector))
+}
+
+// wrapDockerErr classifies an error returned by the Docker client: a
+// network error or context deadline is likely to succeed on retry, so
+// it's Transient; anything else means the daemon itself rejected the
+// request, so it's Upstream.
+func wrapDockerErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return errdefs.NewTransient(err)
+	}
+	return errdefs.NewUpstream(err)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+// fakeDockerClient is the fake DockerClient docker.go's own doc comment
+// promises: a stand-in for the real daemon so resolveContainerID can be
+// tested without Docker installed.
+type fakeDockerClient struct {
+	containers []types.Container
+	listErr    error
+
+	// lastListOptions records the options passed to the most recent
+	// ContainerList call, so tests can assert on how resolveContainerID
+	// queries the daemon (e.g. whether it asks for stopped containers).
+	lastListOptions container.ListOptions
+}
+
+func (f *fakeDockerClient) ContainerList(ctx context.Context, options container.ListOptions) ([]types.Container, error) {
+	f.lastListOptions = options
+	if f.listErr != nil {
+		return nil, f.listErr
+	}
+
+	running := func(c types.Container) bool { return c.State == "" || c.State == "running" }
+
+	if options.Filters.Len() == 0 {
+		if options.All {
+			return f.containers, nil
+		}
+		var out []types.Container
+		for _, c := range f.containers {
+			if running(c) {
+				out = append(out, c)
+			}
+		}
+		return out, nil
+	}
+
+	labelValues := options.Filters.Get("label")
+	var out []types.Container
+	for _, c := range f.containers {
+		if !options.All && !running(c) {
+			continue
+		}
+		for _, kv := range labelValues {
+			k, v, _ := splitLabel(kv)
+			if c.Labels[k] == v {
+				out = append(out, c)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeDockerClient) ContainerExecCreate(ctx context.Context, containerID string, config container.ExecOptions) (types.IDResponse, error) {
+	return types.IDResponse{}, errors.New("not implemented")
+}
+
+func (f *fakeDockerClient) ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+	return types.HijackedResponse{}, errors.New("not implemented")
+}
+
+func (f *fakeDockerClient) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	return container.ExecInspect{}, errors.New("not implemented")
+}
+
+func splitLabel(kv string) (k, v string, ok bool) {
+	for i := 0; i < len(kv); i++ {
+		if kv[i] == '=' {
+			return kv[:i], kv[i+1:], true
+		}
+	}
+	return kv, "", false
+}
+
+func TestResolveContainerIDByName(t *testing.T) {
+	cli := &fakeDockerClient{containers: []types.Container{
+		{ID: "abc123", Names: []string{"/caddy"}},
+	}}
+
+	id, err := resolveContainerID(context.Background(), cli, "caddy")
+	if err != nil {
+		t.Fatalf("resolveContainerID: %v", err)
+	}
+	if id != "abc123" {
+		t.Errorf("id = %q, want %q", id, "abc123")
+	}
+}
+
+func TestResolveContainerIDByIDPrefix(t *testing.T) {
+	cli := &fakeDockerClient{containers: []types.Container{
+		{ID: "abc123456", Names: []string{"/caddy"}},
+	}}
+
+	id, err := resolveContainerID(context.Background(), cli, "abc123")
+	if err != nil {
+		t.Fatalf("resolveContainerID: %v", err)
+	}
+	if id != "abc123456" {
+		t.Errorf("id = %q, want %q", id, "abc123456")
+	}
+}
+
+func TestResolveContainerIDByLabel(t *testing.T) {
+	cli := &fakeDockerClient{containers: []types.Container{
+		{ID: "abc123", Labels: map[string]string{"role": "caddy"}},
+		{ID: "def456", Labels: map[string]string{"role": "other"}},
+	}}
+
+	id, err := resolveContainerID(context.Background(), cli, "role=caddy")
+	if err != nil {
+		t.Fatalf("resolveContainerID: %v", err)
+	}
+	if id != "abc123" {
+		t.Errorf("id = %q, want %q", id, "abc123")
+	}
+}
+
+func TestResolveContainerIDByLabelFindsStoppedContainer(t *testing.T) {
+	cli := &fakeDockerClient{containers: []types.Container{
+		{ID: "abc123", Labels: map[string]string{"role": "caddy"}, State: "exited"},
+	}}
+
+	id, err := resolveContainerID(context.Background(), cli, "role=caddy")
+	if err != nil {
+		t.Fatalf("resolveContainerID: %v", err)
+	}
+	if id != "abc123" {
+		t.Errorf("id = %q, want %q", id, "abc123")
+	}
+	if !cli.lastListOptions.All {
+		t.Error("ContainerList called without All: true; a stopped container would be missed")
+	}
+}
+
+func TestResolveContainerIDNotFound(t *testing.T) {
+	cli := &fakeDockerClient{containers: []types.Container{
+		{ID: "abc123", Names: []string{"/other"}},
+	}}
+
+	_, err := resolveContainerID(context.Background(), cli, "caddy")
+	if !errdefs.IsNotFound(err) {
+		t.Errorf("expected a NotFound error, got: %v", err)
+	}
+}
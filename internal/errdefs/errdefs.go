@@ -0,0 +1,109 @@
+// Package errdefs classifies the errors this tool produces, so callers
+// (chiefly the /hook HTTP handler) can decide how to respond without
+// matching on error strings. It follows the pattern used by moby's
+// api/errdefs: a handful of marker interfaces plus Is* helpers that walk
+// the errors.Unwrap chain looking for one.
+package errdefs
+
+import "errors"
+
+// NotFound marks an error as "a referenced resource does not exist",
+// e.g. no Docker container matches the configured selector.
+type NotFound interface {
+	NotFound() bool
+}
+
+// Unauthorized marks an error as "the caller's credentials were missing
+// or invalid", e.g. a webhook request's HMAC signature didn't match
+// GITHUB_SECRETKEY.
+type Unauthorized interface {
+	Unauthorized() bool
+}
+
+// InvalidConfig marks an error as "the rule set or its result is bad",
+// e.g. a pattern regex matched nothing, or `caddy validate` rejected
+// the generated Caddyfile.
+type InvalidConfig interface {
+	InvalidConfig() bool
+}
+
+// Upstream marks an error as "a downstream service refused the
+// request", e.g. the Docker daemon or Caddy's admin API returned a 5xx.
+type Upstream interface {
+	Upstream() bool
+}
+
+// Transient marks an error as "likely to succeed on retry", e.g. a
+// network timeout talking to the Docker daemon or the admin API.
+type Transient interface {
+	Transient() bool
+}
+
+// IsNotFound reports whether err, or anything it wraps, is NotFound.
+func IsNotFound(err error) bool { return matches[NotFound](err, NotFound.NotFound) }
+
+// IsUnauthorized reports whether err, or anything it wraps, is Unauthorized.
+func IsUnauthorized(err error) bool { return matches[Unauthorized](err, Unauthorized.Unauthorized) }
+
+// IsInvalidConfig reports whether err, or anything it wraps, is InvalidConfig.
+func IsInvalidConfig(err error) bool {
+	return matches[InvalidConfig](err, InvalidConfig.InvalidConfig)
+}
+
+// IsUpstream reports whether err, or anything it wraps, is Upstream.
+func IsUpstream(err error) bool { return matches[Upstream](err, Upstream.Upstream) }
+
+// IsTransient reports whether err, or anything it wraps, is Transient.
+func IsTransient(err error) bool { return matches[Transient](err, Transient.Transient) }
+
+// matches walks err's Unwrap chain looking for a T whose check method
+// returns true.
+func matches[T any](err error, check func(T) bool) bool {
+	for err != nil {
+		if t, ok := err.(T); ok && check(t) {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+type notFound struct{ error }
+
+func (notFound) NotFound() bool  { return true }
+func (e notFound) Unwrap() error { return e.error }
+
+// NewNotFound wraps err so IsNotFound(err) reports true.
+func NewNotFound(err error) error { return notFound{err} }
+
+type unauthorized struct{ error }
+
+func (unauthorized) Unauthorized() bool { return true }
+func (e unauthorized) Unwrap() error    { return e.error }
+
+// NewUnauthorized wraps err so IsUnauthorized(err) reports true.
+func NewUnauthorized(err error) error { return unauthorized{err} }
+
+type invalidConfig struct{ error }
+
+func (invalidConfig) InvalidConfig() bool { return true }
+func (e invalidConfig) Unwrap() error     { return e.error }
+
+// NewInvalidConfig wraps err so IsInvalidConfig(err) reports true.
+func NewInvalidConfig(err error) error { return invalidConfig{err} }
+
+type upstream struct{ error }
+
+func (upstream) Upstream() bool  { return true }
+func (e upstream) Unwrap() error { return e.error }
+
+// NewUpstream wraps err so IsUpstream(err) reports true.
+func NewUpstream(err error) error { return upstream{err} }
+
+type transient struct{ error }
+
+func (transient) Transient() bool { return true }
+func (e transient) Unwrap() error { return e.error }
+
+// NewTransient wraps err so IsTransient(err) reports true.
+func NewTransient(err error) error { return transient{err} }
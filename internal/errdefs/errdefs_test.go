@@ -0,0 +1,48 @@
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestIsHelpers(t *testing.T) {
+	base := errors.New("boom")
+
+	tests := []struct {
+		name string
+		err  error
+		is   func(error) bool
+		want bool
+	}{
+		{"not found direct", NewNotFound(base), IsNotFound, true},
+		{"not found wrapped", fmt.Errorf("context: %w", NewNotFound(base)), IsNotFound, true},
+		{"not found wrong class", NewUpstream(base), IsNotFound, false},
+		{"unauthorized direct", NewUnauthorized(base), IsUnauthorized, true},
+		{"invalid config direct", NewInvalidConfig(base), IsInvalidConfig, true},
+		{"upstream direct", NewUpstream(base), IsUpstream, true},
+		{"transient direct", NewTransient(base), IsTransient, true},
+		{"plain error matches nothing", base, IsNotFound, false},
+		{"nil error matches nothing", nil, IsTransient, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.is(tt.err); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrappedErrorPreservesMessageAndUnwrap(t *testing.T) {
+	base := errors.New("disk full")
+	wrapped := NewUpstream(base)
+
+	if wrapped.Error() != base.Error() {
+		t.Errorf("Error() = %q, want %q", wrapped.Error(), base.Error())
+	}
+	if !errors.Is(wrapped, base) {
+		t.Error("errors.Is(wrapped, base) = false, want true")
+	}
+}
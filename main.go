@@ -1,28 +1,25 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
-	"regexp"
 	"strings"
-	"time"
 
 	"github.com/cbrgm/githubevents/v2/githubevents"
-	"github.com/google/go-github/v78/github"
+	"github.com/google/go-github/v89/github"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
 )
 
 var (
-	caddyFilePath  = getEnv("CADDYFILE_PATH", "/etc/caddy/Caddyfile")
-	caddyContainer = getEnv("CADDY_CONTAINER", "caddy") // container NAME, not ID
-	dockerSock     = getEnv("DOCKER_SOCK", "/var/run/docker.sock")
+	caddyFilePath = getEnv("CADDYFILE_PATH", "/etc/caddy/Caddyfile")
+	// caddyContainer selects the target container: a name, an ID (or ID
+	// prefix), or a "label=value" selector.
+	caddyContainer = getEnv("CADDY_CONTAINER", "caddy")
 )
 
 func getEnv(k, d string) string {
@@ -33,27 +30,27 @@ func getEnv(k, d string) string {
 }
 
 func main() {
-	handle := githubevents.New(getEnv("GITHUB_SECRETKEY", "secret"))
-
-	handle.OnPushEventAny(func(ctx context.Context, deliveryID string, eventName string, event *github.PushEvent) error {
-		newHash := event.GetAfter()
-
-		ref := event.GetRef()
+	reloader, err := newReloader()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		// Only act on pushes to main branch
-		if !strings.EqualFold(ref, "refs/heads/main") {
-			log.Println("Push event is not for main branch. Ref:", ref)
-			return nil
+	ruleSet := defaultRuleSet
+	if rulesPath := os.Getenv("RULES_PATH"); rulesPath != "" {
+		ruleSet, err = loadRuleSet(rulesPath)
+		if err != nil {
+			log.Fatal("load rules: ", err)
 		}
+	}
 
-		log.Println("Push received. Commit:", newHash)
+	secretKey := getEnv("GITHUB_SECRETKEY", "secret")
+	handle := githubevents.New(secretKey)
 
-		if err := updateCaddyfile(newHash); err != nil {
-			log.Println("Failed to update Caddyfile:", err)
-		} else {
-			log.Println("Caddyfile updated successfully.")
-		}
-		if err := reloadCaddyInContainer(dockerSock, caddyContainer); err != nil {
+	handle.OnPushEventAny(func(ctx context.Context, deliveryID string, eventName string, event *github.PushEvent) error {
+		log.Println("Push received. Commit:", event.GetAfter())
+
+		if err := applyPushEvent(ctx, ruleSet, reloader, event); err != nil {
+			log.Println("Failed to apply push event:", err)
 			return err
 		}
 		return nil
@@ -61,10 +58,25 @@ func main() {
 
 	// add a http handleFunc
 	http.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
-		err := handle.HandleEventRequest(r)
+		// Validate and parse the request ourselves instead of going
+		// through handle.HandleEventRequest, so a bad HMAC signature can
+		// be reported as 401 instead of falling through to whatever
+		// status an unclassified error would otherwise get.
+		payload, err := github.ValidatePayload(r, []byte(secretKey))
+		if err != nil {
+			writeHookError(w, errdefs.NewUnauthorized(fmt.Errorf("validate webhook payload: %w", err)))
+			return
+		}
+		event, err := github.ParseWebHook(github.WebHookType(r), payload)
 		if err != nil {
-			fmt.Println("error")
+			writeHookError(w, fmt.Errorf("parse webhook payload: %w", err))
+			return
+		}
+		if err := handle.HandleEvent(r.Context(), github.DeliveryID(r), github.WebHookType(r), event); err != nil {
+			writeHookError(w, err)
+			return
 		}
+		w.WriteHeader(http.StatusOK)
 	})
 
 	// start the server listening on port 8080
@@ -73,119 +85,73 @@ func main() {
 	}
 }
 
-func updateCaddyfile(newHash string) error {
-	data, err := os.ReadFile(caddyFilePath)
-	if err != nil {
-		return err
-	}
-
-	content := string(data)
-
-	// Pattern 1: fixed version number, e.g.
-	// @<hash>/10.11/manifest.json
-	re1 := regexp.MustCompile(`(@)[a-fA-F0-9]{40}(/10\.11/manifest\.json)`)
-
-	// Pattern 2: Caddy placeholder version, e.g.
-	// @<hash>/{http.regexp.VER.1}/manifest.json
-	re2 := regexp.MustCompile(`(@)[a-fA-F0-9]{40}(/\{http\.regexp\.VER\.1\}/manifest\.json)`)
-
-	// Apply replacements
-	updated := re1.ReplaceAllString(content, fmt.Sprintf("@%s$2", newHash))
-	updated = re2.ReplaceAllString(updated, fmt.Sprintf("@%s$2", newHash))
-
-	return os.WriteFile(caddyFilePath, []byte(updated), 0644)
-}
-
-func reloadCaddyInContainer(sockPath, containerName string) error {
-	client := httpClientForUnixSocket(sockPath)
+// updateCaddyfile applies every rule in rules that matches the push
+// event's repository and branch, atomically replacing caddyFilePath.
+// It returns the reload backend requested by the last matching rule
+// that set one (empty if none did) and the file's previous contents,
+// so the caller can restore them if validation or reload fails.
+func updateCaddyfile(rules *RuleSet, event *github.PushEvent) (reloadName string, backup []byte, err error) {
+	repo := event.GetRepo().GetFullName()
+	branch := strings.TrimPrefix(event.GetRef(), "refs/heads/")
 
-	resp, err := client.Get("http://unix/containers/json")
-	if err != nil {
-		return fmt.Errorf("docker list containers: %w", err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("docker list containers failed: %s", string(b))
+	matches := rules.rulesFor(repo, branch, "push")
+	if len(matches) == 0 {
+		return "", nil, errdefs.NewInvalidConfig(fmt.Errorf("no rules match repo %q branch %q", repo, branch))
 	}
 
-	var containers []struct {
-		ID    string   `json:"Id"`
-		Names []string `json:"Names"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
-		return fmt.Errorf("decode containers list: %w", err)
+	data, err := os.ReadFile(caddyFilePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, errdefs.NewNotFound(fmt.Errorf("read caddyfile: %w", err))
+		}
+		return "", nil, fmt.Errorf("read caddyfile: %w", err)
 	}
 
-	var containerID string
-	for _, c := range containers {
-		for _, n := range c.Names {
-			if strings.TrimPrefix(n, "/") == containerName {
-				containerID = c.ID
-				break
-			}
+	vars := templateVarsFromPush(event)
+	content := string(data)
+	for _, rule := range matches {
+		content, err = applyRule(content, rule, vars)
+		if err != nil {
+			return "", nil, err
 		}
-		if containerID != "" {
-			break
+		if rule.Reload != "" {
+			reloadName = rule.Reload
 		}
 	}
-	if containerID == "" {
-		return fmt.Errorf("container %q not found", containerName)
-	}
-
-	type createExecReq struct {
-		AttachStdout bool     `json:"AttachStdout"`
-		AttachStderr bool     `json:"AttachStderr"`
-		Cmd          []string `json:"Cmd"`
-	}
-	reqBody := createExecReq{
-		AttachStdout: false,
-		AttachStderr: false,
-		Cmd:          []string{"caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"},
-	}
-	body, _ := json.Marshal(reqBody)
-	url := fmt.Sprintf("http://unix/containers/%s/exec", containerID)
-	execResp, err := client.Post(url, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return fmt.Errorf("docker create exec: %w", err)
-	}
-	defer execResp.Body.Close()
-	if execResp.StatusCode >= 400 {
-		b, _ := io.ReadAll(execResp.Body)
-		return fmt.Errorf("docker create exec failed: %s", string(b))
-	}
-
-	var createResp struct {
-		ID string `json:"Id"`
-	}
-	if err := json.NewDecoder(execResp.Body).Decode(&createResp); err != nil {
-		return fmt.Errorf("decode create exec resp: %w", err)
-	}
-	if createResp.ID == "" {
-		return errors.New("empty exec id")
-	}
 
-	startURL := fmt.Sprintf("http://unix/exec/%s/start", createResp.ID)
-	startReq := map[string]bool{"Detach": true, "Tty": false}
-	startBody, _ := json.Marshal(startReq)
-	startResp, err := client.Post(startURL, "application/json", bytes.NewReader(startBody))
-	if err != nil {
-		return fmt.Errorf("docker start exec: %w", err)
-	}
-	defer startResp.Body.Close()
-	if startResp.StatusCode >= 400 {
-		b, _ := io.ReadAll(startResp.Body)
-		return fmt.Errorf("docker start exec failed: %s", string(b))
+	if err := atomicWriteFile(caddyFilePath, []byte(content)); err != nil {
+		return "", nil, fmt.Errorf("write caddyfile: %w", err)
 	}
+	return reloadName, data, nil
+}
 
-	return nil
+// hookErrorResponse is the JSON body written for a failed /hook
+// delivery, so GitHub's webhook delivery UI shows something more
+// useful than a bare status code.
+type hookErrorResponse struct {
+	Error string `json:"error"`
 }
 
-func httpClientForUnixSocket(sockPath string) *http.Client {
-	tr := &http.Transport{
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			return net.Dial("unix", sockPath)
-		},
-	}
-	return &http.Client{Transport: tr, Timeout: 10 * time.Second}
+// writeHookError maps err to an HTTP status via its errdefs
+// classification and writes it as a small JSON body. An unclassified
+// error defaults to 500, since none of the known classes apply.
+func writeHookError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errdefs.IsNotFound(err):
+		status = http.StatusNotFound
+	case errdefs.IsUnauthorized(err):
+		status = http.StatusUnauthorized
+	case errdefs.IsInvalidConfig(err):
+		status = http.StatusUnprocessableEntity
+	case errdefs.IsUpstream(err):
+		status = http.StatusBadGateway
+	case errdefs.IsTransient(err):
+		status = http.StatusServiceUnavailable
+	}
+
+	log.Println("hook error:", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(hookErrorResponse{Error: err.Error()})
 }
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+// Reloader triggers a Caddy configuration reload through some backend.
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// Validator is optionally implemented by a Reloader that can check a
+// candidate Caddyfile before it's applied, so callers can reject a bad
+// substitution instead of reloading Caddy into a broken config.
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// newReloader builds the Reloader selected by RELOADER (default
+// "docker"). "admin" talks to Caddy's admin API instead, which lets the
+// tool run without access to the docker socket.
+func newReloader() (Reloader, error) {
+	return reloaderFor(getEnv("RELOADER", "docker"))
+}
+
+// reloaderFor builds the Reloader named by name ("docker" or "admin"),
+// so a per-rule Reload override can pick a different backend than the
+// process-wide RELOADER default.
+func reloaderFor(name string) (Reloader, error) {
+	switch strings.ToLower(name) {
+	case "docker":
+		return &DockerExecReloader{Container: caddyContainer}, nil
+	case "admin":
+		return newAdminAPIReloader(), nil
+	default:
+		return nil, fmt.Errorf("unknown reload backend %q (want \"docker\" or \"admin\")", name)
+	}
+}
+
+// DockerExecReloader reloads Caddy by running `caddy reload` inside the
+// target container via `docker exec`.
+type DockerExecReloader struct {
+	Container string
+
+	// Client overrides how the Docker client is obtained, so tests can
+	// inject a fake instead of talking to a real daemon. Nil means use
+	// newDockerClient.
+	Client DockerClient
+}
+
+func (r *DockerExecReloader) Reload(ctx context.Context) error {
+	if err := r.exec(ctx, []string{"caddy", "reload", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"}, "caddy reload"); err != nil {
+		var exitErr *execExitError
+		if errors.As(err, &exitErr) {
+			return errdefs.NewUpstream(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Validate runs `caddy validate` inside the container against the
+// Caddyfile already on disk, so a bad substitution can be caught before
+// Reload ever restarts the running config.
+func (r *DockerExecReloader) Validate(ctx context.Context) error {
+	if err := r.exec(ctx, []string{"caddy", "validate", "--config", "/etc/caddy/Caddyfile", "--adapter", "caddyfile"}, "caddy validate"); err != nil {
+		var exitErr *execExitError
+		if errors.As(err, &exitErr) {
+			return errdefs.NewInvalidConfig(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// execExitError reports that a command run inside the container
+// completed but exited non-zero. Reload and Validate each classify it
+// differently: a failed reload means Caddy's own upstream state is bad,
+// a failed validate means the generated config is bad.
+type execExitError struct {
+	label    string
+	exitCode int
+	stderr   string
+}
+
+func (e *execExitError) Error() string {
+	return fmt.Sprintf("%s exited with code %d: %s", e.label, e.exitCode, e.stderr)
+}
+
+// exec runs cmd inside the target container, attached, and returns an
+// error if the docker exec itself fails (classified via wrapDockerErr)
+// or the command exits non-zero (an *execExitError). label identifies
+// the command in log lines and error messages.
+func (r *DockerExecReloader) exec(ctx context.Context, cmd []string, label string) error {
+	cli := r.Client
+	if cli == nil {
+		dockerCli, err := newDockerClient()
+		if err != nil {
+			return err
+		}
+		cli = dockerCli
+	}
+
+	containerID, err := resolveContainerID(ctx, cli, r.Container)
+	if err != nil {
+		return err
+	}
+
+	execID, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          false,
+	})
+	if err != nil {
+		return wrapDockerErr(fmt.Errorf("docker create exec: %w", err))
+	}
+
+	attachResp, err := cli.ContainerExecAttach(ctx, execID.ID, container.ExecAttachOptions{Detach: false, Tty: false})
+	if err != nil {
+		return wrapDockerErr(fmt.Errorf("docker attach exec: %w", err))
+	}
+	defer attachResp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, attachResp.Reader); err != nil {
+		return wrapDockerErr(fmt.Errorf("read exec stream: %w", err))
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, execID.ID)
+	if err != nil {
+		return wrapDockerErr(fmt.Errorf("inspect exec: %w", err))
+	}
+
+	if stdout.Len() > 0 {
+		log.Println(label, "stdout:", stdout.String())
+	}
+	if stderr.Len() > 0 {
+		log.Println(label, "stderr:", stderr.String())
+	}
+
+	if inspect.ExitCode != 0 {
+		return &execExitError{label: label, exitCode: inspect.ExitCode, stderr: strings.TrimSpace(stderr.String())}
+	}
+
+	return nil
+}
+
+// AdminAPIReloader reloads Caddy through its admin API
+// (https://caddyserver.com/docs/api) instead of docker exec, so the tool
+// can run as an unprivileged process with no access to the docker
+// socket.
+type AdminAPIReloader struct {
+	AdminURL    string
+	ConfigPath  string
+	Adapter     string // e.g. "caddyfile"; empty means the config is already JSON
+	BearerToken string
+	HTTPClient  *http.Client
+}
+
+func newAdminAPIReloader() *AdminAPIReloader {
+	return &AdminAPIReloader{
+		AdminURL:    getEnv("CADDY_ADMIN_URL", "http://localhost:2019"),
+		ConfigPath:  caddyFilePath,
+		Adapter:     getEnv("CADDY_ADMIN_ADAPTER", "caddyfile"),
+		BearerToken: os.Getenv("CADDY_ADMIN_TOKEN"),
+		HTTPClient:  newAdminHTTPClient(),
+	}
+}
+
+// newAdminHTTPClient builds the client used to talk to the admin API,
+// configuring mTLS when CADDY_ADMIN_CLIENT_CERT/KEY (and optionally
+// CADDY_ADMIN_CA) are set.
+func newAdminHTTPClient() *http.Client {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	certFile := os.Getenv("CADDY_ADMIN_CLIENT_CERT")
+	keyFile := os.Getenv("CADDY_ADMIN_CLIENT_KEY")
+	if certFile == "" || keyFile == "" {
+		return client
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		log.Println("load admin api client cert:", err)
+		return client
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if caFile := os.Getenv("CADDY_ADMIN_CA"); caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			log.Println("read admin api ca:", err)
+		} else {
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(caPEM)
+			tlsConfig.RootCAs = pool
+		}
+	}
+
+	client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+	return client
+}
+
+func (r *AdminAPIReloader) Reload(ctx context.Context) error {
+	data, err := os.ReadFile(r.ConfigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errdefs.NewNotFound(fmt.Errorf("read caddyfile: %w", err))
+		}
+		return fmt.Errorf("read caddyfile: %w", err)
+	}
+
+	config := data
+	if r.Adapter != "" && r.Adapter != "json" {
+		config, err = r.adapt(ctx, data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.post(ctx, "/load", config, "application/json")
+}
+
+// adapt converts a Caddyfile (or other non-JSON config) to Caddy's JSON
+// config via POST /adapt.
+func (r *AdminAPIReloader) adapt(ctx context.Context, raw []byte) ([]byte, error) {
+	url := fmt.Sprintf("%s/adapt?adapter=%s", strings.TrimRight(r.AdminURL, "/"), r.Adapter)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("build adapt request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/"+r.Adapter)
+	r.authenticate(req)
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return nil, wrapAdminAPIDoErr(fmt.Errorf("caddy admin api /adapt: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, wrapAdminAPIDoErr(fmt.Errorf("read /adapt response: %w", err))
+	}
+	if resp.StatusCode >= 400 {
+		return nil, wrapAdminAPIStatusErr(resp.StatusCode, fmt.Errorf("caddy admin api /adapt failed (%d): %s", resp.StatusCode, string(body)))
+	}
+
+	var adapted struct {
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(body, &adapted); err != nil {
+		return nil, errdefs.NewUpstream(fmt.Errorf("decode /adapt response: %w", err))
+	}
+	return adapted.Result, nil
+}
+
+func (r *AdminAPIReloader) post(ctx context.Context, path string, body []byte, contentType string) error {
+	url := strings.TrimRight(r.AdminURL, "/") + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build %s request: %w", path, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	r.authenticate(req)
+
+	resp, err := r.HTTPClient.Do(req)
+	if err != nil {
+		return wrapAdminAPIDoErr(fmt.Errorf("caddy admin api %s: %w", path, err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		b, _ := io.ReadAll(resp.Body)
+		return wrapAdminAPIStatusErr(resp.StatusCode, fmt.Errorf("caddy admin api %s failed (%d): %s", path, resp.StatusCode, string(b)))
+	}
+	return nil
+}
+
+// wrapAdminAPIDoErr classifies a transport-level failure talking to the
+// admin API: a timeout or network error is likely to succeed on retry.
+func wrapAdminAPIDoErr(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return errdefs.NewTransient(err)
+	}
+	return errdefs.NewUpstream(err)
+}
+
+// wrapAdminAPIStatusErr classifies an admin API response by status
+// code: 400/422 mean the generated config was rejected, 5xx mean the
+// admin API itself failed.
+func wrapAdminAPIStatusErr(status int, err error) error {
+	switch {
+	case status == http.StatusBadRequest || status == http.StatusUnprocessableEntity:
+		return errdefs.NewInvalidConfig(err)
+	case status >= 500:
+		return errdefs.NewUpstream(err)
+	default:
+		return err
+	}
+}
+
+func (r *AdminAPIReloader) authenticate(req *http.Request) {
+	if r.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.BearerToken)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+// fakeConn is a minimal net.Conn that serves Read from a fixed buffer and
+// discards writes, so it can back a types.HijackedResponse in tests
+// without a real docker exec attach stream.
+type fakeConn struct {
+	net.Conn
+	r *bytes.Reader
+}
+
+func (c *fakeConn) Read(p []byte) (int, error)       { return c.r.Read(p) }
+func (c *fakeConn) Write(p []byte) (int, error)      { return len(p), nil }
+func (c *fakeConn) Close() error                     { return nil }
+func (c *fakeConn) SetDeadline(time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+// execDockerClient is a fake DockerClient covering the exec/attach/inspect
+// path DockerExecReloader.exec drives, so the stream-demux and
+// non-zero-exit-code handling can be exercised without a real daemon.
+type execDockerClient struct {
+	fakeDockerClient
+
+	stdout, stderr string
+	exitCode       int
+	attachErr      error
+	inspectErr     error
+}
+
+func (c *execDockerClient) ContainerExecCreate(ctx context.Context, containerID string, config container.ExecOptions) (types.IDResponse, error) {
+	return types.IDResponse{ID: "exec1"}, nil
+}
+
+func (c *execDockerClient) ContainerExecAttach(ctx context.Context, execID string, config container.ExecAttachOptions) (types.HijackedResponse, error) {
+	if c.attachErr != nil {
+		return types.HijackedResponse{}, c.attachErr
+	}
+
+	var framed bytes.Buffer
+	stdoutW := stdcopy.NewStdWriter(&framed, stdcopy.Stdout)
+	stdoutW.Write([]byte(c.stdout))
+	stderrW := stdcopy.NewStdWriter(&framed, stdcopy.Stderr)
+	stderrW.Write([]byte(c.stderr))
+
+	conn := &fakeConn{r: bytes.NewReader(framed.Bytes())}
+	return types.NewHijackedResponse(conn, ""), nil
+}
+
+func (c *execDockerClient) ContainerExecInspect(ctx context.Context, execID string) (container.ExecInspect, error) {
+	if c.inspectErr != nil {
+		return container.ExecInspect{}, c.inspectErr
+	}
+	return container.ExecInspect{ExitCode: c.exitCode}, nil
+}
+
+func newExecReloader(cli DockerClient) *DockerExecReloader {
+	return &DockerExecReloader{Container: "caddy", Client: cli}
+}
+
+func TestDockerExecReloaderReloadSuccess(t *testing.T) {
+	cli := &execDockerClient{
+		fakeDockerClient: fakeDockerClient{containers: []types.Container{{ID: "c1", Names: []string{"/caddy"}}}},
+		exitCode:         0,
+	}
+
+	if err := newExecReloader(cli).Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+}
+
+func TestDockerExecReloaderReloadNonZeroExit(t *testing.T) {
+	cli := &execDockerClient{
+		fakeDockerClient: fakeDockerClient{containers: []types.Container{{ID: "c1", Names: []string{"/caddy"}}}},
+		stderr:           "admin endpoint unreachable",
+		exitCode:         1,
+	}
+
+	err := newExecReloader(cli).Reload(context.Background())
+	if err == nil {
+		t.Fatal("expected an error for a non-zero exit code")
+	}
+	if !errdefs.IsUpstream(err) {
+		t.Errorf("expected an Upstream error, got: %v", err)
+	}
+	var exitErr *execExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("expected an *execExitError in the chain, got: %v", err)
+	}
+	if exitErr.stderr != "admin endpoint unreachable" {
+		t.Errorf("stderr = %q, want %q", exitErr.stderr, "admin endpoint unreachable")
+	}
+	if !strings.Contains(err.Error(), "admin endpoint unreachable") {
+		t.Errorf("error message %q doesn't mention the captured stderr", err.Error())
+	}
+}
+
+func TestDockerExecReloaderValidateNonZeroExit(t *testing.T) {
+	cli := &execDockerClient{
+		fakeDockerClient: fakeDockerClient{containers: []types.Container{{ID: "c1", Names: []string{"/caddy"}}}},
+		stderr:           "unrecognized directive: frobnicate",
+		exitCode:         1,
+	}
+
+	err := newExecReloader(cli).Validate(context.Background())
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "unrecognized directive: frobnicate") {
+		t.Errorf("error message %q doesn't mention the captured stderr", err.Error())
+	}
+}
+
+func TestDockerExecReloaderContainerNotFound(t *testing.T) {
+	cli := &execDockerClient{fakeDockerClient: fakeDockerClient{containers: nil}}
+
+	err := newExecReloader(cli).Reload(context.Background())
+	if !errdefs.IsNotFound(err) {
+		t.Errorf("expected a NotFound error when the container can't be resolved, got: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v89/github"
+	"gopkg.in/yaml.v3"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+// Pattern is a single regex/replacement pair within a Rule. ID must be
+// unique across the whole rule set so it can be referenced in logs and
+// errors without ambiguity.
+type Pattern struct {
+	ID      string `yaml:"id" json:"id"`
+	Regex   string `yaml:"regex" json:"regex"`
+	Replace string `yaml:"replace" json:"replace"`
+
+	compiled *regexp.Regexp
+}
+
+// Rule describes the Caddyfile substitutions to apply for events
+// matching Repo/Branch/Event, and which Reloader to use afterwards.
+//
+// Event is validated against supportedEvents: only "push" is wired up to
+// a handler today, so a rule naming any other event would silently
+// never match.
+type Rule struct {
+	Repo     string    `yaml:"repo" json:"repo"`
+	Branch   string    `yaml:"branch" json:"branch"`
+	Event    string    `yaml:"event" json:"event"`
+	Patterns []Pattern `yaml:"patterns" json:"patterns"`
+	Reload   string    `yaml:"reload" json:"reload"`
+}
+
+// supportedEvents lists the event names a Rule may match. Extend this
+// (and wire the matching githubevents handler in main) before accepting
+// "release" or "workflow_run" here.
+var supportedEvents = map[string]bool{
+	"":     true, // matches any event
+	"push": true,
+}
+
+// supportedReloaders lists the reload backend names a Rule's Reload may
+// name, matching the cases reloaderFor (reload.go) handles.
+var supportedReloaders = map[string]bool{
+	"":       true, // use the process-wide RELOADER default
+	"docker": true,
+	"admin":  true,
+}
+
+// RuleSet is the document read from RULES_PATH: a flat list of rules.
+type RuleSet struct {
+	Rules []Rule `yaml:"rules" json:"rules"`
+}
+
+// templateVars are the placeholders available inside a Pattern's
+// replace template.
+type templateVars struct {
+	SHA      string
+	ShortSHA string
+	Tag      string
+	Ref      string
+}
+
+// templateVarsFromPush builds templateVars from a GitHub push event.
+func templateVarsFromPush(event *github.PushEvent) templateVars {
+	ref := event.GetRef()
+	sha := event.GetAfter()
+
+	vars := templateVars{SHA: sha, Ref: ref, ShortSHA: sha}
+	if len(sha) > 7 {
+		vars.ShortSHA = sha[:7]
+	}
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		vars.Tag = tag
+	}
+	return vars
+}
+
+// loadRuleSet reads and validates RULES_PATH (YAML or JSON, by
+// extension). Every pattern regex must compile and every pattern ID
+// must be unique across the whole file, so a bad config fails loudly at
+// startup rather than at webhook time.
+func loadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errdefs.NewNotFound(fmt.Errorf("read rules file: %w", err))
+		}
+		return nil, fmt.Errorf("read rules file: %w", err)
+	}
+
+	var set RuleSet
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &set); err != nil {
+			return nil, errdefs.NewInvalidConfig(fmt.Errorf("parse rules file: %w", err))
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &set); err != nil {
+			return nil, errdefs.NewInvalidConfig(fmt.Errorf("parse rules file: %w", err))
+		}
+	default:
+		return nil, errdefs.NewInvalidConfig(fmt.Errorf("unsupported rules file extension %q (want .yaml, .yml or .json)", ext))
+	}
+
+	seenIDs := make(map[string]bool)
+	for ri := range set.Rules {
+		rule := &set.Rules[ri]
+		if rule.Repo == "" {
+			return nil, errdefs.NewInvalidConfig(fmt.Errorf("rule %d: repo is required", ri))
+		}
+		if !supportedEvents[strings.ToLower(rule.Event)] {
+			return nil, errdefs.NewInvalidConfig(fmt.Errorf("rule %d (%s): event %q is not supported (only \"push\" is wired up)", ri, rule.Repo, rule.Event))
+		}
+		if !supportedReloaders[strings.ToLower(rule.Reload)] {
+			return nil, errdefs.NewInvalidConfig(fmt.Errorf("rule %d (%s): reload backend %q is not supported (want \"docker\", \"admin\", or empty for the process default)", ri, rule.Repo, rule.Reload))
+		}
+		for pi := range rule.Patterns {
+			p := &rule.Patterns[pi]
+			if p.ID == "" {
+				return nil, errdefs.NewInvalidConfig(fmt.Errorf("rule %d (%s) pattern %d: id is required", ri, rule.Repo, pi))
+			}
+			if seenIDs[p.ID] {
+				return nil, errdefs.NewInvalidConfig(fmt.Errorf("duplicate pattern id %q", p.ID))
+			}
+			seenIDs[p.ID] = true
+
+			compiled, err := regexp.Compile(p.Regex)
+			if err != nil {
+				return nil, errdefs.NewInvalidConfig(fmt.Errorf("pattern %q: invalid regex %q: %w", p.ID, p.Regex, err))
+			}
+			p.compiled = compiled
+		}
+	}
+
+	return &set, nil
+}
+
+// rulesFor returns the rules matching repoFullName/branch/event, in the
+// order they appear in the config. An empty Branch or Event on a rule
+// matches anything.
+func (s *RuleSet) rulesFor(repoFullName, branch, event string) []Rule {
+	var matches []Rule
+	for _, rule := range s.Rules {
+		if rule.Repo != "" && !strings.EqualFold(rule.Repo, repoFullName) {
+			continue
+		}
+		if rule.Branch != "" && !strings.EqualFold(rule.Branch, branch) {
+			continue
+		}
+		if rule.Event != "" && !strings.EqualFold(rule.Event, event) {
+			continue
+		}
+		matches = append(matches, rule)
+	}
+	return matches
+}
+
+// defaultRuleSet reproduces the tool's original hardcoded behaviour
+// (any repo, main branch only) for deployments that don't set
+// RULES_PATH.
+var defaultRuleSet = &RuleSet{
+	Rules: []Rule{
+		{
+			Branch: "main",
+			Event:  "push",
+			Patterns: []Pattern{
+				{ID: "version-pin", Regex: `(@)[a-fA-F0-9]{40}(/10\.11/manifest\.json)`, Replace: "@{{.SHA}}$2"},
+				{ID: "version-placeholder", Regex: `(@)[a-fA-F0-9]{40}(/\{http\.regexp\.VER\.1\}/manifest\.json)`, Replace: "@{{.SHA}}$2"},
+			},
+		},
+	},
+}
+
+// applyRule runs every pattern in rule against content, rendering each
+// pattern's replace template against vars first (so both {{.SHA}}-style
+// variables and regexp backreferences like $2 work).
+func applyRule(content string, rule Rule, vars templateVars) (string, error) {
+	for _, p := range rule.Patterns {
+		re := p.compiled
+		if re == nil {
+			compiled, err := regexp.Compile(p.Regex)
+			if err != nil {
+				return "", errdefs.NewInvalidConfig(fmt.Errorf("pattern %q: invalid regex %q: %w", p.ID, p.Regex, err))
+			}
+			re = compiled
+		}
+
+		if !re.MatchString(content) {
+			return "", errdefs.NewInvalidConfig(fmt.Errorf("pattern %q: regex %q matched nothing in %s", p.ID, p.Regex, caddyFilePath))
+		}
+
+		replace, err := renderReplaceTemplate(p.ID, p.Replace, vars)
+		if err != nil {
+			return "", errdefs.NewInvalidConfig(err)
+		}
+		content = re.ReplaceAllString(content, replace)
+	}
+	return content, nil
+}
+
+func renderReplaceTemplate(id, text string, vars templateVars) (string, error) {
+	tmpl, err := template.New(id).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("pattern %q: invalid replace template: %w", id, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("pattern %q: render replace template: %w", id, err)
+	}
+	return buf.String(), nil
+}
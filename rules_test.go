@@ -0,0 +1,246 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-github/v89/github"
+
+	"github.com/jumoog/go_caddy_url_updater/internal/errdefs"
+)
+
+func TestTemplateVarsFromPush(t *testing.T) {
+	event := &github.PushEvent{
+		Ref:   github.String("refs/heads/main"),
+		After: github.String("deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"),
+	}
+
+	vars := templateVarsFromPush(event)
+	if vars.SHA != "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef" {
+		t.Errorf("SHA = %q", vars.SHA)
+	}
+	if vars.ShortSHA != "deadbee" {
+		t.Errorf("ShortSHA = %q, want %q", vars.ShortSHA, "deadbee")
+	}
+	if vars.Ref != "refs/heads/main" {
+		t.Errorf("Ref = %q", vars.Ref)
+	}
+	if vars.Tag != "" {
+		t.Errorf("Tag = %q, want empty for a branch push", vars.Tag)
+	}
+}
+
+func TestTemplateVarsFromPushTagRef(t *testing.T) {
+	event := &github.PushEvent{
+		Ref:   github.String("refs/tags/v1.2.3"),
+		After: github.String("abc"),
+	}
+
+	vars := templateVarsFromPush(event)
+	if vars.Tag != "v1.2.3" {
+		t.Errorf("Tag = %q, want %q", vars.Tag, "v1.2.3")
+	}
+	if vars.ShortSHA != "abc" {
+		t.Errorf("ShortSHA = %q, want the full SHA unchanged when it's under 7 chars", vars.ShortSHA)
+	}
+}
+
+func TestRulesFor(t *testing.T) {
+	set := &RuleSet{
+		Rules: []Rule{
+			{Repo: "acme/api", Branch: "main", Event: "push"},
+			{Repo: "acme/api", Event: "push"}, // any branch
+			{Repo: "acme/web"},
+		},
+	}
+
+	tests := []struct {
+		name                string
+		repo, branch, event string
+		want                int
+	}{
+		{"exact match", "acme/api", "main", "push", 2},
+		{"any-branch rule still matches other branch", "acme/api", "dev", "push", 1},
+		{"repo case-insensitive", "ACME/API", "main", "push", 2},
+		{"no match", "acme/other", "main", "push", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := set.rulesFor(tt.repo, tt.branch, tt.event)
+			if len(got) != tt.want {
+				t.Errorf("rulesFor(%q, %q, %q) = %d rules, want %d", tt.repo, tt.branch, tt.event, len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRule(t *testing.T) {
+	rule := Rule{
+		Patterns: []Pattern{
+			{ID: "pin", Regex: `(@)[a-f0-9]{40}(/manifest\.json)`, Replace: "@{{.SHA}}$2"},
+		},
+	}
+	vars := templateVars{SHA: "deadbeefdeadbeefdeadbeefdeadbeefdeadbeef"}
+
+	out, err := applyRule("reverse_proxy @aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa/manifest.json", rule, vars)
+	if err != nil {
+		t.Fatalf("applyRule: %v", err)
+	}
+	want := "reverse_proxy @deadbeefdeadbeefdeadbeefdeadbeefdeadbeef/manifest.json"
+	if out != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func TestApplyRuleNoMatchIsInvalidConfig(t *testing.T) {
+	rule := Rule{
+		Patterns: []Pattern{
+			{ID: "pin", Regex: `nope`, Replace: "x"},
+		},
+	}
+
+	_, err := applyRule("no match here", rule, templateVars{})
+	if err == nil {
+		t.Fatal("expected an error when the pattern matches nothing")
+	}
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	doc := `
+rules:
+  - repo: acme/api
+    branch: main
+    event: push
+    reload: admin
+    patterns:
+      - id: pin
+        regex: "(@)[a-f0-9]{40}"
+        replace: "@{{.SHA}}"
+`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	set, err := loadRuleSet(path)
+	if err != nil {
+		t.Fatalf("loadRuleSet: %v", err)
+	}
+	if len(set.Rules) != 1 || set.Rules[0].Repo != "acme/api" {
+		t.Errorf("unexpected rule set: %+v", set)
+	}
+}
+
+func TestLoadRuleSetMissingFile(t *testing.T) {
+	_, err := loadRuleSet(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Fatal("expected an error for a missing rules file")
+	}
+	if !errdefs.IsNotFound(err) {
+		t.Errorf("expected a NotFound error, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetDuplicatePatternID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	doc := `
+rules:
+  - repo: acme/api
+    patterns:
+      - id: pin
+        regex: "a"
+        replace: "b"
+  - repo: acme/web
+    patterns:
+      - id: pin
+        regex: "c"
+        replace: "d"
+`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	_, err := loadRuleSet(path)
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error for a duplicate pattern id, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetBadRegex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	doc := `
+rules:
+  - repo: acme/api
+    patterns:
+      - id: pin
+        regex: "("
+        replace: "b"
+`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	_, err := loadRuleSet(path)
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error for an invalid regex, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetUnsupportedEvent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	doc := `
+rules:
+  - repo: acme/api
+    event: release
+    patterns:
+      - id: pin
+        regex: "a"
+        replace: "b"
+`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	_, err := loadRuleSet(path)
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error for an unsupported event, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetUnsupportedReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	doc := `
+rules:
+  - repo: acme/api
+    reload: amdin
+    patterns:
+      - id: pin
+        regex: "a"
+        replace: "b"
+`
+	if err := os.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	_, err := loadRuleSet(path)
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error for an unsupported reload backend, got: %v", err)
+	}
+}
+
+func TestLoadRuleSetUnsupportedExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.toml")
+	if err := os.WriteFile(path, []byte("rules = []"), 0644); err != nil {
+		t.Fatalf("write rules file: %v", err)
+	}
+
+	_, err := loadRuleSet(path)
+	if !errdefs.IsInvalidConfig(err) {
+		t.Errorf("expected an InvalidConfig error for an unsupported extension, got: %v", err)
+	}
+}